@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// diagnosticsTailLines caps how much container log history is pulled per
+// pod, mirroring the "dump kubectl logs on e2e failure" pattern rather
+// than fetching a pod's entire log history.
+const diagnosticsTailLines = 200
+
+// diagnosticsDir is the root directory diagnostic bundles are written
+// under, set via --diagnostics-dir. Diagnostics collection is disabled
+// when it's empty, which is the default.
+var diagnosticsDir string
+
+func init() {
+	flag.StringVar(&diagnosticsDir, "diagnostics-dir", "", "directory to write pod logs/describe/events to when a wave times out or fails validation (disabled if empty)")
+}
+
+// runDiagnosticsDir is this run's subdirectory under diagnosticsDir, so
+// repeated invocations (e.g. re-runs in the same CI job) don't clobber
+// each other's bundles.
+var runDiagnosticsDir = startTime.Format("20060102-150405")
+
+// collectDiagnostics dumps each pod's container logs, full object state,
+// and related namespace events to diagnosticsDir/<run>/<deployment>/<pod>/,
+// returning the paths written for the caller to reference in its own
+// error log line. Collection is best-effort: a failure to gather one
+// pod's diagnostics is logged and skipped rather than propagated, since
+// diagnostics must never be the reason a rollout run itself fails.
+func (c *k8sClient) collectDiagnostics(deployment string, pods []Pod) []string {
+	if diagnosticsDir == "" || len(pods) == 0 {
+		return nil
+	}
+
+	var written []string
+	for _, p := range pods {
+		dir := filepath.Join(diagnosticsDir, runDiagnosticsDir, deployment, p.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			logMessage(errorMark, "Failed to create diagnostics dir %s: %v", dir, err)
+			continue
+		}
+
+		c.dumpPod(dir, p.Name)
+		c.dumpPodLogs(dir, p.Name)
+		c.dumpEvents(dir, p.Name)
+
+		written = append(written, dir)
+	}
+	return written
+}
+
+// dumpPod writes the full Pod object as JSON, standing in for `kubectl
+// describe pod` output without pulling in kubectl's describe package.
+func (c *k8sClient) dumpPod(dir, podName string) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		logMessage(warning, "Failed to get pod %s for diagnostics: %v", podName, err)
+		return
+	}
+	writeJSONFile(filepath.Join(dir, "pod.json"), pod)
+}
+
+// dumpPodLogs writes the last diagnosticsTailLines of each container's log
+// to its own file under dir.
+func (c *k8sClient) dumpPodLogs(dir, podName string) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		logMessage(warning, "Failed to get pod %s for log collection: %v", podName, err)
+		return
+	}
+
+	tail := int64(diagnosticsTailLines)
+	for _, container := range pod.Spec.Containers {
+		stream, err := c.clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+			Container: container.Name,
+			TailLines: &tail,
+		}).Stream(context.TODO())
+		if err != nil {
+			logMessage(warning, "Failed to fetch logs for %s/%s: %v", podName, container.Name, err)
+			continue
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("logs-%s.txt", container.Name))
+		if err := writeStreamToFile(path, stream); err != nil {
+			logMessage(warning, "Failed to write logs for %s/%s: %v", podName, container.Name, err)
+		}
+	}
+}
+
+// dumpEvents writes the namespace Events involving podName as JSON.
+func (c *k8sClient) dumpEvents(dir, podName string) {
+	selector := fields.Set{
+		"involvedObject.name":      podName,
+		"involvedObject.namespace": namespace,
+	}.AsSelector()
+	events, err := c.clientset.CoreV1().Events(namespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: selector.String(),
+	})
+	if err != nil {
+		logMessage(warning, "Failed to list events for %s: %v", podName, err)
+		return
+	}
+	writeJSONFile(filepath.Join(dir, "events.json"), events.Items)
+}
+
+func writeJSONFile(path string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		logMessage(warning, "Failed to marshal diagnostics for %s: %v", path, err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		logMessage(warning, "Failed to write diagnostics file %s: %v", path, err)
+	}
+}
+
+func writeStreamToFile(path string, stream io.ReadCloser) error {
+	defer stream.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, stream)
+	return err
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+)
+
+// revisionAnnotation is the annotation the Deployment controller stamps
+// onto each ReplicaSet it owns, recording that ReplicaSet's rollout
+// revision number.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// namespace is the namespace all deployments managed by this tool live in.
+// Resolved once at startup from the in-cluster service account, the
+// kubeconfig's current context, or falls back to "default".
+var namespace = "default"
+
+// k8sClient wraps a kubernetes.Interface so the rest of this package can
+// scale deployments and wait for rollouts without shelling out to kubectl.
+type k8sClient struct {
+	clientset kubernetes.Interface
+}
+
+// newK8sClient builds a k8sClient, preferring in-cluster config (so the tool
+// can run as a Job/Deployment under a service account) and falling back to
+// the local kubeconfig for out-of-cluster use.
+func newK8sClient() (*k8sClient, error) {
+	cfg, err := rest.InClusterConfig()
+	if err == nil {
+		if data, readErr := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); readErr == nil {
+			if ns := strings.TrimSpace(string(data)); ns != "" {
+				namespace = ns
+			}
+		}
+	} else {
+		kubeconfig := os.Getenv("KUBECONFIG")
+		if kubeconfig == "" {
+			kubeconfig = clientcmd.RecommendedHomeFile
+		}
+		loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig}
+		overrides := &clientcmd.ConfigOverrides{}
+		clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+		cfg, err = clientConfig.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("building kube config: %w", err)
+		}
+		if ns, _, err := clientConfig.Namespace(); err == nil && ns != "" {
+			namespace = ns
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("building clientset: %w", err)
+	}
+
+	return &k8sClient{clientset: clientset}, nil
+}
+
+// getDeploymentReplicas returns the desired (spec) replica count for name.
+func (c *k8sClient) getDeploymentReplicas(ctx context.Context, name string) int {
+	scale, err := c.clientset.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logMessage(errorMark, "Failed to get replicas for %s: %v", name, err)
+		return 0
+	}
+	return int(scale.Spec.Replicas)
+}
+
+// scaleDeployment sets the desired replica count for name via the scale
+// subresource, retrying on update conflicts.
+func (c *k8sClient) scaleDeployment(ctx context.Context, name string, replicas int) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		scale, err := c.clientset.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		scale.Spec.Replicas = int32(replicas)
+		_, err = c.clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// getPods lists the running pods owned by deployment name, keyed off its
+// selector, for validatePods to probe.
+func (c *k8sClient) getPods(name string) []Pod {
+	ctx := context.TODO()
+	dep, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logMessage(errorMark, "Failed to get deployment %s for pod lookup: %v", name, err)
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(dep.Spec.Selector)
+	if err != nil {
+		logMessage(errorMark, "Failed to resolve selector for %s: %v", name, err)
+		return nil
+	}
+
+	podList, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		logMessage(errorMark, "Failed to list pods for %s: %v", name, err)
+		return nil
+	}
+
+	var pods []Pod
+	for _, p := range podList.Items {
+		if p.Status.Phase != corev1.PodRunning || p.Status.PodIP == "" {
+			continue
+		}
+		pods = append(pods, Pod{Name: p.Name, IP: p.Status.PodIP})
+	}
+	return pods
+}
+
+// waitForDeploymentReady watches name until it reaches readiness. By
+// default readiness means the rollout has converged: the controller has
+// observed the latest spec, all replicas have been updated, and enough are
+// available to satisfy the rolling update's maxUnavailable budget. This
+// mirrors the readiness check Helm's kube.Wait performs. If minReady is
+// non-negative, the deployment is instead considered ready as soon as the
+// new ReplicaSet has at least minReady ready pods, letting a wave proceed
+// under partial degradation. It returns early on success and returns an
+// error if timeout elapses first, or if ctx is cancelled first (by a
+// sibling deployment in the same wave failing hard).
+func (c *k8sClient) waitForDeploymentReady(ctx context.Context, name string, timeout time.Duration, minReady int) error {
+	deadline := time.Now().Add(timeout)
+
+	check := func(d *appsv1.Deployment) bool {
+		if d.Status.ObservedGeneration < d.Generation {
+			return false
+		}
+		if minReady >= 0 {
+			ready, err := c.newReplicaSetReadyReplicas(ctx, d)
+			if err != nil {
+				logMessage(warning, "Failed to resolve new ReplicaSet for %s: %v", d.Name, err)
+				return false
+			}
+			return ready >= int32(minReady)
+		}
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		if d.Status.UpdatedReplicas < replicas {
+			return false
+		}
+		maxUnavailable := maxUnavailableFor(d, replicas)
+		return d.Status.AvailableReplicas >= replicas-maxUnavailable
+	}
+
+	d, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("getting deployment %s: %w", name, err)
+	}
+	if check(d) {
+		return nil
+	}
+
+	watcher, err := c.clientset.AppsV1().Deployments(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("watching deployment %s: %w", name, err)
+	}
+	defer watcher.Stop()
+
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("timeout reached waiting for %s to become ready", name)
+		}
+
+		select {
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return fmt.Errorf("watch closed before %s became ready", name)
+			}
+			d, ok := event.Object.(*appsv1.Deployment)
+			if !ok {
+				continue
+			}
+			if check(d) {
+				return nil
+			}
+			logMessage(waiting, "Waiting for %s to be ready...", name)
+		case <-time.After(remaining):
+			return fmt.Errorf("timeout reached waiting for %s to become ready", name)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// maxUnavailableFor resolves the deployment's RollingUpdate.MaxUnavailable
+// (absolute or percentage) against the desired replica count, defaulting to
+// 25% as the Deployment controller itself does.
+func maxUnavailableFor(d *appsv1.Deployment, replicas int32) int32 {
+	ru := d.Spec.Strategy.RollingUpdate
+	if d.Spec.Strategy.Type != appsv1.RollingUpdateDeploymentStrategyType || ru == nil || ru.MaxUnavailable == nil {
+		return replicas / 4
+	}
+	v, err := intstr.GetScaledValueFromIntOrPercent(ru.MaxUnavailable, int(replicas), false)
+	if err != nil {
+		return replicas / 4
+	}
+	return int32(v)
+}
+
+// rollback applies d's RollbackPolicy after failure has been observed on
+// one of its pods. An empty policy (or "none") is a no-op.
+func (c *k8sClient) rollback(d Deployment, failure *validationFailure) error {
+	switch d.RollbackPolicy {
+	case "", "none":
+		return nil
+	case "scale-down":
+		return c.scaleDeployment(context.TODO(), d.Name, d.InitialReplicas)
+	case "kubectl-rollout-undo":
+		return c.undoRollout(d.Name)
+	case "pause":
+		return c.pauseRollout(d.Name)
+	default:
+		return fmt.Errorf("unknown rollback policy %q for %s", d.RollbackPolicy, d.Name)
+	}
+}
+
+// undoRollout reverts a deployment to the ReplicaSet revision immediately
+// before its current one, the same end state `kubectl rollout undo` leaves
+// it in.
+func (c *k8sClient) undoRollout(name string) error {
+	ctx := context.TODO()
+
+	dep, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("getting deployment %s: %w", name, err)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(dep.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("resolving selector for %s: %w", name, err)
+	}
+	rsList, err := c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return fmt.Errorf("listing replica sets for %s: %w", name, err)
+	}
+
+	var owned []*appsv1.ReplicaSet
+	for i := range rsList.Items {
+		rs := &rsList.Items[i]
+		if metav1.IsControlledBy(rs, dep) {
+			owned = append(owned, rs)
+		}
+	}
+	if len(owned) < 2 {
+		return fmt.Errorf("no previous revision available to roll back %s to", name)
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return revisionOf(owned[i]) < revisionOf(owned[j])
+	})
+	previous := owned[len(owned)-2]
+
+	dep.Spec.Template = previous.Spec.Template
+	_, err = c.clientset.AppsV1().Deployments(namespace).Update(ctx, dep, metav1.UpdateOptions{})
+	return err
+}
+
+// pauseRollout freezes a deployment's rollout so an operator can
+// investigate before anything else changes its pod template.
+func (c *k8sClient) pauseRollout(name string) error {
+	ctx := context.TODO()
+	dep, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("getting deployment %s: %w", name, err)
+	}
+	dep.Spec.Paused = true
+	_, err = c.clientset.AppsV1().Deployments(namespace).Update(ctx, dep, metav1.UpdateOptions{})
+	return err
+}
+
+// revisionOf reads the rollout revision the Deployment controller stamped
+// onto rs, defaulting to 0 if absent or unparsable.
+func revisionOf(rs *appsv1.ReplicaSet) int {
+	v, _ := strconv.Atoi(rs.Annotations[revisionAnnotation])
+	return v
+}
+
+// newReplicaSetReadyReplicas resolves the ReplicaSet the Deployment
+// controller is currently rolling out to (the one with the highest
+// revision annotation among those it owns) and returns its ready replica
+// count. This is what min-ready readiness should be checked against,
+// since the Deployment's own Status.ReadyReplicas also counts pods from
+// any old ReplicaSet still scaling down.
+func (c *k8sClient) newReplicaSetReadyReplicas(ctx context.Context, d *appsv1.Deployment) (int32, error) {
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return 0, fmt.Errorf("resolving selector for %s: %w", d.Name, err)
+	}
+	rsList, err := c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return 0, fmt.Errorf("listing replica sets for %s: %w", d.Name, err)
+	}
+
+	var newest *appsv1.ReplicaSet
+	for i := range rsList.Items {
+		rs := &rsList.Items[i]
+		if !metav1.IsControlledBy(rs, d) {
+			continue
+		}
+		if newest == nil || revisionOf(rs) > revisionOf(newest) {
+			newest = rs
+		}
+	}
+	if newest == nil {
+		return 0, fmt.Errorf("no replica set owned by %s found", d.Name)
+	}
+	return newest.Status.ReadyReplicas, nil
+}
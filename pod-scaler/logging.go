@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// structuredLog is the process-wide JSON logger. Replacing the old
+// emoji-decorated fmt.Printf output, every log line is now a single JSON
+// record so CI/CD operators can filter and aggregate it instead of
+// scraping stdout by eye.
+var structuredLog = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+// logMessage keeps the call sites that narrate overall progress (icon,
+// format, args) but now emits a structured JSON record instead of a
+// printed emoji line. The icon selects the log level: errorMark -> error,
+// warning -> warn, everything else -> info.
+func logMessage(icon string, format string, args ...interface{}) {
+	event := structuredLog.Info()
+	switch icon {
+	case errorMark:
+		event = structuredLog.Error()
+	case warning:
+		event = structuredLog.Warn()
+	}
+	event.Msg(fmt.Sprintf(format, args...))
+}
+
+// logPhase emits the structured record operators actually want to graph:
+// which wave and deployment a phase (scale|wait|validate) ran for, how
+// many replicas were involved, how long it took, and whether it failed.
+func logPhase(wave int, deployment, phase string, replicas int, duration time.Duration, err error) {
+	event := structuredLog.Info()
+	if err != nil {
+		event = structuredLog.Error().Err(err)
+	}
+	event.
+		Int("wave", wave).
+		Str("deployment", deployment).
+		Str("phase", phase).
+		Int("replicas", replicas).
+		Int64("duration_ms", duration.Milliseconds()).
+		Msg(phase)
+}
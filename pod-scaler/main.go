@@ -1,22 +1,27 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
-	"net/http"
+	"math"
 	"os"
-	"os/exec"
-	"sort"
-	"strings"
+	"strconv"
 	"time"
 )
 
 // Structs for Configuration
 type Config struct {
 	Deployments []Deployment `json:"deployments"`
+
+	// WorkerPoolSize bounds how many deployments within a wave are scaled
+	// concurrently. Zero (the default) uses runtime.NumCPU().
+	WorkerPoolSize int `json:"workerPoolSize,omitempty"`
+
+	// MetricsAddr is the address the /metrics, /healthz, and /livez HTTP
+	// server listens on. Defaults to ":9090".
+	MetricsAddr string `json:"metricsAddr,omitempty"`
 }
 
 type Deployment struct {
@@ -29,8 +34,29 @@ type Deployment struct {
 	ReadinessTimeout string       `json:"readinessTimeout"`
 	MaxRetries       int          `json:"maxRetries"`
 	Validation       Validation   `json:"validation"`
+
+	// MinReadyReplicas and MinReadyPercent let a wave proceed once the new
+	// ReplicaSet has reached a partial readiness target instead of requiring
+	// every replica to become available. MinReadyReplicas takes precedence
+	// when both are set; if neither is set the deployment must reach full
+	// readiness (minus the rollout's own maxUnavailable budget) as before.
+	MinReadyReplicas int     `json:"minReadyReplicas,omitempty"`
+	MinReadyPercent  float64 `json:"minReadyPercent,omitempty"`
+
+	// RollbackPolicy controls what happens when this deployment's pods fail
+	// validation: "none" (default) applies no rollback, "scale-down"
+	// returns the deployment to InitialReplicas, "kubectl-rollout-undo"
+	// reverts to the previous ReplicaSet revision, and "pause" freezes the
+	// rollout for an operator to investigate. Whatever the policy, a
+	// validation failure halts the run before any later wave starts.
+	RollbackPolicy string `json:"rollbackPolicy,omitempty"`
 }
 
+// Validation describes the probe run against each pod before a wave is
+// considered healthy. Type selects the probe: "http" (default), "grpc" for
+// a grpc.health.v1.Health/Check call, or "tcp" for a bare connect probe.
+// The literal "{{POD_IP}}" in URL is replaced with the pod's IP before the
+// probe runs.
 type Validation struct {
 	Type            string            `json:"type"`
 	URL             string            `json:"url"`
@@ -39,12 +65,30 @@ type Validation struct {
 	Body            string            `json:"body,omitempty"`
 	Headers         map[string]string `json:"headers,omitempty"`
 	Check           CheckCondition    `json:"check"`
+	TLS             *TLSConfig        `json:"tls,omitempty"`
+
+	// Service is the service name passed as HealthCheckRequest.Service for a
+	// "grpc" probe. Ignored by the "http" and "tcp" probe types.
+	Service string `json:"service,omitempty"`
 }
 
+// CheckCondition extracts Field from the probe response (JSONPath-like dot
+// notation, e.g. "status.phase" or "items[0].ready") and compares it
+// against Value using Condition: eq, ne, gt, lt, contains, or regex. An
+// empty Field falls back to a bare 2xx/connect-succeeded check.
 type CheckCondition struct {
-	Field    string      `json:"field"`
-	Condition string     `json:"condition"`
-	Value    interface{} `json:"value"`
+	Field     string      `json:"field"`
+	Condition string      `json:"condition"`
+	Value     interface{} `json:"value"`
+}
+
+// TLSConfig configures the transport used for HTTP and gRPC probes against
+// endpoints that require TLS or mTLS.
+type TLSConfig struct {
+	CAFile             string `json:"caFile,omitempty"`
+	CertFile           string `json:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
 }
 
 type Pod struct {
@@ -66,31 +110,91 @@ const (
 // Global Start Time for Logging
 var startTime = time.Now()
 
+// Process exit codes. Success and generic failures use Go's conventional
+// 0/1; these distinguish the specific failure modes operators care about.
+const (
+	exitConfigError      = 2
+	exitValidationFailed = 3
+	exitWaveFailed       = 4
+)
+
+// validationFailure records the first pod validation failure seen for a
+// deployment so the caller can decide whether and how to roll back.
+type validationFailure struct {
+	Deployment string
+	Pod        string
+	PodIP      string
+}
+
 func main() {
+	flag.Parse()
 	logMessage(rocket, "Starting Pod Scaler...")
 
+	client, err := newK8sClient()
+	if err != nil {
+		logMessage(errorMark, "Failed to build Kubernetes client: %v", err)
+		os.Exit(exitConfigError)
+	}
+
 	// Load configuration
 	config, err := loadConfig("/config/deployments.yaml")
 	if err != nil {
-		log.Fatalf("%s Failed to load config: %v", errorMark, err)
+		logMessage(errorMark, "Failed to load config: %v", err)
+		os.Exit(exitConfigError)
+	}
+
+	metricsAddr := config.MetricsAddr
+	if metricsAddr == "" {
+		metricsAddr = ":9090"
 	}
+	startMetricsServer(metricsAddr)
+	logMessage(rocket, "Metrics server listening on %s", metricsAddr)
 
 	// Group deployments by wave
 	waveMap := groupByWave(config.Deployments)
 
-	// Process waves sequentially
+	// Process waves sequentially; within a wave, deployments scale and
+	// become ready concurrently.
 	for wave, deployments := range waveMap {
+		waveStart := time.Now()
 		logMessage(rocket, "Starting wave %d...", wave)
-		scaleDeploymentsRoundRobin(deployments)
-		logMessage(waiting, "Wave %d scaling complete. Waiting for readiness...", wave)
-		waitForDeployments(deployments)
+		if err := runWave(client, deployments, config.WorkerPoolSize); err != nil {
+			logMessage(errorMark, "Wave %d failed: %v", wave, err)
+			os.Exit(exitWaveFailed)
+		}
 		logMessage(checkMark, "Wave %d ready. Proceeding to validation...", wave)
-		validatePods(deployments)
+
+		if failure := validatePods(client, deployments); failure != nil {
+			handleValidationFailure(client, deployments, failure)
+			os.Exit(exitValidationFailed)
+		}
+
+		waveDurationSeconds.WithLabelValues(strconv.Itoa(wave)).Observe(time.Since(waveStart).Seconds())
 	}
 
 	logMessage(magicHat, "All waves completed successfully!")
 }
 
+// handleValidationFailure logs which pod triggered the failure and applies
+// its deployment's RollbackPolicy before the caller halts the rollout.
+func handleValidationFailure(client *k8sClient, deployments []Deployment, failure *validationFailure) {
+	logMessage(errorMark, "event=validation_failed deployment=%s pod=%s pod_ip=%s", failure.Deployment, failure.Pod, failure.PodIP)
+
+	var target Deployment
+	for _, d := range deployments {
+		if d.Name == failure.Deployment {
+			target = d
+			break
+		}
+	}
+
+	if err := client.rollback(target, failure); err != nil {
+		logMessage(errorMark, "event=rollback_failed deployment=%s policy=%s error=%v", target.Name, target.RollbackPolicy, err)
+		return
+	}
+	logMessage(warning, "event=rollback_applied deployment=%s policy=%s", target.Name, target.RollbackPolicy)
+}
+
 // Load configuration from file
 func loadConfig(path string) (Config, error) {
 	var config Config
@@ -111,69 +215,13 @@ func groupByWave(deployments []Deployment) map[int][]Deployment {
 	return waveMap
 }
 
-// Scale up deployments round-robin within a wave
-func scaleDeploymentsRoundRobin(deployments []Deployment) {
-	anyScaled := true
-	for anyScaled {
-		anyScaled = false
-		for i, d := range deployments {
-			currentReplicas := getDeploymentReplicas(d.Name)
-			if currentReplicas < d.MaxReplicas {
-				newReplicas := min(currentReplicas+d.ScaleStep, d.MaxReplicas)
-				scaleDeployment(d.Name, newReplicas)
-				logMessage(checkMark, "Scaled %s to %d replicas", d.Name, newReplicas)
-				anyScaled = true
-			}
-			if i < len(deployments)-1 {
-				time.Sleep(parseDuration(d.ScaleInterval))
-			}
-		}
-	}
-}
-
-// Get deployment replica count
-func getDeploymentReplicas(name string) int {
-	out, err := exec.Command("kubectl", "get", "deployment", name, "-o", "jsonpath={.spec.replicas}").Output()
-	if err != nil {
-		logMessage(errorMark, "Failed to get replicas for %s", name)
-		return 0
-	}
-	var replicas int
-	fmt.Sscanf(string(out), "%d", &replicas)
-	return replicas
-}
-
-// Scale a deployment
-func scaleDeployment(name string, replicas int) {
-	_ = exec.Command("kubectl", "scale", "deployment", name, fmt.Sprintf("--replicas=%d", replicas)).Run()
-}
-
-// Wait for deployments to be ready with timeout
-func waitForDeployments(deployments []Deployment) {
+// Validate Pods. Returns the first validation failure encountered, or nil
+// if every deployment's pods passed, so the caller can trigger a rollback
+// and halt subsequent waves.
+func validatePods(client *k8sClient, deployments []Deployment) *validationFailure {
 	for _, d := range deployments {
-		timeout := parseDuration(d.ReadinessTimeout)
-		start := time.Now()
-
-		for {
-			if time.Since(start) > timeout {
-				logMessage(errorMark, "Timeout reached for %s. Proceeding anyway...", d.Name)
-				break
-			}
-
-			out, err := exec.Command("kubectl", "get", "deployment", d.Name, "-o", "jsonpath={.status.readyReplicas}").Output()
-			if err == nil && strings.TrimSpace(string(out)) == fmt.Sprint(d.MaxReplicas) {
-				break
-			}
-			logMessage(waiting, "Waiting for %s to be ready...", d.Name)
-			time.Sleep(10 * time.Second)
-		}
-	}
-}
-
-// Validate Pods
-func validatePods(deployments []Deployment) {
-	for _, d := range deployments {
-		pods := getPods(d.Name)
+		validateStart := time.Now()
+		pods := client.getPods(d.Name)
 		retries := d.MaxRetries
 
 		for retries > 0 && len(pods) > 0 {
@@ -182,9 +230,12 @@ func validatePods(deployments []Deployment) {
 			for i := 0; i < len(pods); i++ {
 				p := pods[i]
 				if validatePod(p, d.Validation) {
+					validationAttemptsTotal.WithLabelValues("pass").Inc()
 					logMessage(checkMark, "Pod %s (%s) passed validation", p.Name, p.IP)
 					pods = append(pods[:i], pods[i+1:]...)
 					i--
+				} else {
+					validationAttemptsTotal.WithLabelValues("fail").Inc()
 				}
 			}
 
@@ -197,16 +248,40 @@ func validatePods(deployments []Deployment) {
 		}
 
 		if len(pods) > 0 {
-			logMessage(errorMark, "Some pods failed validation after %d retries: %v", d.MaxRetries, pods)
+			err := fmt.Errorf("%d pods failed validation after %d retries", len(pods), d.MaxRetries)
+			paths := client.collectDiagnostics(d.Name, pods)
+			if len(paths) > 0 {
+				logMessage(errorMark, "Some pods failed validation after %d retries: %v. Diagnostics: %v", d.MaxRetries, pods, paths)
+			} else {
+				logMessage(errorMark, "Some pods failed validation after %d retries: %v", d.MaxRetries, pods)
+			}
+			logPhase(d.Wave, d.Name, "validate", len(pods), time.Since(validateStart), err)
+			return &validationFailure{Deployment: d.Name, Pod: pods[0].Name, PodIP: pods[0].IP}
 		}
+		logPhase(d.Wave, d.Name, "validate", len(pods), time.Since(validateStart), nil)
 	}
+	return nil
 }
 
-// Universal Logging Function with MM:SS timestamp
-func logMessage(icon string, format string, args ...interface{}) {
-	elapsed := time.Since(startTime)
-	fmt.Printf("[%02d:%02d] %s %s\n",
-		int(elapsed.Minutes()), int(elapsed.Seconds())%60, icon, fmt.Sprintf(format, args...))
+// minReadyTarget resolves a deployment's partial-readiness threshold.
+// MinReadyReplicas takes precedence over MinReadyPercent; -1 means neither
+// is configured, so waitForDeploymentReady should fall back to requiring
+// full availability.
+func minReadyTarget(d Deployment) int {
+	if d.MinReadyReplicas > 0 {
+		if d.MinReadyReplicas > d.MaxReplicas {
+			return d.MaxReplicas
+		}
+		return d.MinReadyReplicas
+	}
+	if d.MinReadyPercent > 0 {
+		target := int(math.Ceil(d.MinReadyPercent / 100 * float64(d.MaxReplicas)))
+		if target > d.MaxReplicas {
+			target = d.MaxReplicas
+		}
+		return target
+	}
+	return -1
 }
 
 // Helper Functions
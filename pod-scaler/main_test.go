@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestMinReadyTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Deployment
+		want int
+	}{
+		{
+			name: "min ready replicas within bounds",
+			d:    Deployment{MaxReplicas: 10, MinReadyReplicas: 4},
+			want: 4,
+		},
+		{
+			name: "min ready replicas clamped above max",
+			d:    Deployment{MaxReplicas: 10, MinReadyReplicas: 20},
+			want: 10,
+		},
+		{
+			name: "min ready replicas takes precedence over percent",
+			d:    Deployment{MaxReplicas: 10, MinReadyReplicas: 4, MinReadyPercent: 90},
+			want: 4,
+		},
+		{
+			name: "min ready percent ceil-rounds",
+			d:    Deployment{MaxReplicas: 10, MinReadyPercent: 51},
+			want: 6,
+		},
+		{
+			name: "min ready percent clamped above max",
+			d:    Deployment{MaxReplicas: 10, MinReadyPercent: 150},
+			want: 10,
+		},
+		{
+			name: "neither set falls back to -1",
+			d:    Deployment{MaxReplicas: 10},
+			want: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minReadyTarget(tt.d); got != tt.want {
+				t.Fatalf("minReadyTarget(%+v) = %d, want %d", tt.d, got, tt.want)
+			}
+		})
+	}
+}
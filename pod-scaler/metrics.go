@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	waveDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rollout_wave_duration_seconds",
+		Help:    "Time to scale, wait for readiness, and validate a single wave.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"wave"})
+
+	deploymentScaleStepTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rollout_deployment_scale_step_total",
+		Help: "Scale steps applied to a deployment.",
+	}, []string{"deployment"})
+
+	validationAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rollout_validation_attempts_total",
+		Help: "Pod validation attempts, labeled by result.",
+	}, []string{"result"})
+
+	podReadySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rollout_pod_ready_seconds",
+		Help:    "Time spent waiting for a deployment's pods to become ready.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"deployment"})
+)
+
+// startMetricsServer exposes /metrics alongside /healthz and /livez on
+// addr, so this tool can itself run as a long-lived Job or Deployment
+// instead of only being scraped by eye through stdout.
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logMessage(errorMark, "Metrics server on %s failed: %v", addr, err)
+		}
+	}()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Default token-bucket rates protecting the API server from a wave with
+// many deployments scaling at once. globalRPS bounds the wave as a whole;
+// perDeploymentRPS further bounds each deployment's own goroutine.
+const (
+	globalRPS        = 20
+	perDeploymentRPS = 5
+)
+
+// runWave scales every deployment in a wave concurrently, each on its own
+// goroutine stepping from the deployment's current spec replica count to
+// MaxReplicas by ScaleStep and then waiting for readiness, bounded by a
+// worker pool of size poolSize (runtime.NumCPU() if poolSize <= 0) and
+// global/per-deployment rate limiters. InitialReplicas is not applied
+// before the first step. The wave completes once every goroutine
+// finishes; if any deployment fails hard (a scale error) the remaining
+// goroutines are cancelled and that error is returned. Readiness wait
+// errors, whether a timeout or a failed watch, are logged and non-fatal.
+func runWave(client *k8sClient, deployments []Deployment, poolSize int) error {
+	if poolSize <= 0 {
+		poolSize = runtime.NumCPU()
+	}
+	sem := make(chan struct{}, poolSize)
+	globalLimiter := rate.NewLimiter(rate.Limit(globalRPS), globalRPS)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(deployments))
+
+	for _, d := range deployments {
+		d := d
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			if err := scaleAndWaitOne(ctx, client, d, globalLimiter); err != nil {
+				if errors.Is(err, context.Canceled) {
+					// A sibling deployment already failed hard and cancelled
+					// ctx; this is that cascade, not a fresh root cause.
+					return
+				}
+				logMessage(errorMark, "%s failed hard: %v", d.Name, err)
+				errs <- fmt.Errorf("%s: %w", d.Name, err)
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scaleAndWaitOne drives a single deployment through its own scale-then-wait
+// lifecycle, respecting ctx cancellation from a sibling's hard failure.
+func scaleAndWaitOne(ctx context.Context, client *k8sClient, d Deployment, globalLimiter *rate.Limiter) error {
+	perDeploymentLimiter := rate.NewLimiter(rate.Limit(perDeploymentRPS), perDeploymentRPS)
+	interval := parseDuration(d.ScaleInterval)
+
+	scaleStart := time.Now()
+	current := client.getDeploymentReplicas(ctx, d.Name)
+	for current < d.MaxReplicas {
+		if err := globalLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		if err := perDeploymentLimiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		next := min(current+d.ScaleStep, d.MaxReplicas)
+		if err := client.scaleDeployment(ctx, d.Name, next); err != nil {
+			logPhase(d.Wave, d.Name, "scale", current, time.Since(scaleStart), err)
+			return fmt.Errorf("scaling to %d: %w", next, err)
+		}
+		deploymentScaleStepTotal.WithLabelValues(d.Name).Inc()
+		logMessage(checkMark, "Scaled %s to %d replicas", d.Name, next)
+		current = next
+
+		if current < d.MaxReplicas {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	logPhase(d.Wave, d.Name, "scale", current, time.Since(scaleStart), nil)
+
+	waitStart := time.Now()
+	timeout := parseDuration(d.ReadinessTimeout)
+	minReady := minReadyTarget(d)
+	err := client.waitForDeploymentReady(ctx, d.Name, timeout, minReady)
+	podReadySeconds.WithLabelValues(d.Name).Observe(time.Since(waitStart).Seconds())
+	logPhase(d.Wave, d.Name, "wait", current, time.Since(waitStart), err)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		paths := client.collectDiagnostics(d.Name, client.getPods(d.Name))
+		if len(paths) > 0 {
+			logMessage(errorMark, "%v. Diagnostics: %v. Proceeding anyway...", err, paths)
+		} else {
+			logMessage(errorMark, "%v. Proceeding anyway...", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// podIPPlaceholder is substituted with the target pod's IP in a
+// Validation's URL before the probe runs.
+const podIPPlaceholder = "{{POD_IP}}"
+
+// validatePod runs v's probe against pod and reports whether it passed.
+// Errors (unreachable endpoint, bad TLS config, ...) count as a failed
+// probe rather than propagating, since the caller's retry loop is the
+// mechanism for recovering from transient failures.
+func validatePod(pod Pod, v Validation) bool {
+	switch strings.ToLower(v.Type) {
+	case "grpc":
+		return probeGRPC(pod, v)
+	case "tcp":
+		return probeTCP(pod, v)
+	default:
+		return probeHTTP(pod, v)
+	}
+}
+
+// probeHTTP issues the configured HTTP request against the pod and, if a
+// Check field is set, extracts and compares it from the JSON response body.
+func probeHTTP(pod Pod, v Validation) bool {
+	url := strings.ReplaceAll(v.URL, podIPPlaceholder, pod.IP)
+	method := v.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if v.Body != "" {
+		body = strings.NewReader(v.Body)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		logMessage(warning, "Validation request build failed for %s: %v", pod.Name, err)
+		return false
+	}
+	for k, val := range v.Headers {
+		req.Header.Set(k, val)
+	}
+
+	tlsConfig, err := buildTLSConfig(v.TLS)
+	if err != nil {
+		logMessage(warning, "Validation TLS config invalid for %s: %v", pod.Name, err)
+		return false
+	}
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	if v.Check.Field == "" {
+		return resp.StatusCode >= 200 && resp.StatusCode < 300
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false
+	}
+	var parsed interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return false
+	}
+	actual, err := extractField(parsed, v.Check.Field)
+	if err != nil {
+		return false
+	}
+	ok, err := compareValues(actual, v.Check.Condition, v.Check.Value)
+	if err != nil {
+		logMessage(warning, "Validation check error for %s: %v", pod.Name, err)
+		return false
+	}
+	return ok
+}
+
+// probeTCP checks that a TCP (optionally TLS) connection to the pod's
+// validation endpoint can be established.
+func probeTCP(pod Pod, v Validation) bool {
+	addr := strings.ReplaceAll(v.URL, podIPPlaceholder, pod.IP)
+
+	if v.TLS != nil {
+		tlsConfig, err := buildTLSConfig(v.TLS)
+		if err != nil {
+			logMessage(warning, "Validation TLS config invalid for %s: %v", pod.Name, err)
+			return false
+		}
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, tlsConfig)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// probeGRPC calls grpc.health.v1.Health/Check against the pod, the same
+// RPC Kubernetes gRPC readiness probes use.
+func probeGRPC(pod Pod, v Validation) bool {
+	addr := strings.ReplaceAll(v.URL, podIPPlaceholder, pod.IP)
+
+	var dialOpt grpc.DialOption
+	if v.TLS != nil {
+		tlsConfig, err := buildTLSConfig(v.TLS)
+		if err != nil {
+			logMessage(warning, "Validation TLS config invalid for %s: %v", pod.Name, err)
+			return false
+		}
+		dialOpt = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	} else {
+		dialOpt = grpc.WithTransportCredentials(insecure.NewCredentials())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, dialOpt, grpc.WithBlock())
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: v.Service})
+	if err != nil {
+		return false
+	}
+	return resp.Status == healthpb.HealthCheckResponse_SERVING
+}
+
+// buildTLSConfig turns a *TLSConfig into a *tls.Config, loading the CA
+// bundle and client cert/key when configured. A nil TLSConfig yields a nil
+// *tls.Config, which leaves an HTTP probe on net/http's default TLS
+// settings for https URLs.
+func buildTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	if cfg.CAFile != "" {
+		caCert, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle %s: %w", cfg.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client cert/key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// extractField walks a JSONPath-like dotted path (e.g. "status.phase" or
+// "items[0].ready") over a decoded JSON value.
+func extractField(v interface{}, field string) (interface{}, error) {
+	current := v
+	for _, segment := range strings.Split(field, ".") {
+		name, index, hasIndex := splitIndex(segment)
+		if name != "" {
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("field %q: %q is not an object", field, name)
+			}
+			val, ok := m[name]
+			if !ok {
+				return nil, fmt.Errorf("field %q: key %q not found", field, name)
+			}
+			current = val
+		}
+		if hasIndex {
+			arr, ok := current.([]interface{})
+			if !ok || index >= len(arr) {
+				return nil, fmt.Errorf("field %q: index %d out of range", field, index)
+			}
+			current = arr[index]
+		}
+	}
+	return current, nil
+}
+
+// splitIndex splits a path segment like "items[0]" into ("items", 0, true),
+// or "status" into ("status", 0, false).
+func splitIndex(segment string) (name string, index int, hasIndex bool) {
+	open := strings.Index(segment, "[")
+	if open == -1 || !strings.HasSuffix(segment, "]") {
+		return segment, 0, false
+	}
+	name = segment[:open]
+	idx, err := strconv.Atoi(segment[open+1 : len(segment)-1])
+	if err != nil {
+		return segment, 0, false
+	}
+	return name, idx, true
+}
+
+// compareValues implements the CheckCondition operators: eq, ne, gt, lt,
+// contains, and regex.
+func compareValues(actual interface{}, condition string, expected interface{}) (bool, error) {
+	switch strings.ToLower(condition) {
+	case "eq":
+		return fmt.Sprint(actual) == fmt.Sprint(expected), nil
+	case "ne":
+		return fmt.Sprint(actual) != fmt.Sprint(expected), nil
+	case "gt", "lt":
+		a, aErr := toFloat(actual)
+		e, eErr := toFloat(expected)
+		if aErr != nil || eErr != nil {
+			return false, fmt.Errorf("%s comparison requires numeric values, got %v and %v", condition, actual, expected)
+		}
+		if condition == "gt" {
+			return a > e, nil
+		}
+		return a < e, nil
+	case "contains":
+		return strings.Contains(fmt.Sprint(actual), fmt.Sprint(expected)), nil
+	case "regex":
+		re, err := regexp.Compile(fmt.Sprint(expected))
+		if err != nil {
+			return false, fmt.Errorf("invalid regex %q: %w", expected, err)
+		}
+		return re.MatchString(fmt.Sprint(actual)), nil
+	default:
+		return false, fmt.Errorf("unknown check condition %q", condition)
+	}
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	default:
+		return 0, fmt.Errorf("value %v is not numeric", v)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExtractField(t *testing.T) {
+	doc := map[string]interface{}{
+		"status": map[string]interface{}{
+			"phase": "Running",
+		},
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "ready": true},
+			map[string]interface{}{"name": "b", "ready": false},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		field   string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "top-level key", field: "status", want: doc["status"]},
+		{name: "nested key", field: "status.phase", want: "Running"},
+		{name: "indexed element", field: "items[0].name", want: "a"},
+		{name: "indexed bool", field: "items[1].ready", want: false},
+		{name: "missing key", field: "status.missing", wantErr: true},
+		{name: "non-object traversal", field: "status.phase.nope", wantErr: true},
+		{name: "index out of range", field: "items[5].name", wantErr: true},
+		{name: "non-array indexed", field: "status[0]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractField(doc, tt.field)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("extractField(%q) = %v, want error", tt.field, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractField(%q) returned unexpected error: %v", tt.field, err)
+			}
+			if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", tt.want) {
+				t.Fatalf("extractField(%q) = %v, want %v", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		actual    interface{}
+		condition string
+		expected  interface{}
+		want      bool
+		wantErr   bool
+	}{
+		{name: "eq match", actual: "Running", condition: "eq", expected: "Running", want: true},
+		{name: "eq mismatch", actual: "Running", condition: "eq", expected: "Pending", want: false},
+		{name: "eq numeric as string", actual: 3.0, condition: "eq", expected: "3", want: true},
+		{name: "ne match", actual: "Running", condition: "ne", expected: "Pending", want: true},
+		{name: "ne mismatch", actual: "Running", condition: "ne", expected: "Running", want: false},
+		{name: "gt true", actual: 5.0, condition: "gt", expected: 3.0, want: true},
+		{name: "gt false", actual: 2.0, condition: "gt", expected: 3.0, want: false},
+		{name: "lt true", actual: 2.0, condition: "lt", expected: 3.0, want: true},
+		{name: "gt non-numeric", actual: "abc", condition: "gt", expected: 3.0, wantErr: true},
+		{name: "contains match", actual: "hello world", condition: "contains", expected: "world", want: true},
+		{name: "contains mismatch", actual: "hello world", condition: "contains", expected: "bye", want: false},
+		{name: "regex match", actual: "v1.2.3", condition: "regex", expected: `^v\d+\.\d+\.\d+$`, want: true},
+		{name: "regex mismatch", actual: "abc", condition: "regex", expected: `^\d+$`, want: false},
+		{name: "regex invalid", actual: "abc", condition: "regex", expected: `(`, wantErr: true},
+		{name: "unknown condition", actual: "abc", condition: "startswith", expected: "a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compareValues(tt.actual, tt.condition, tt.expected)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("compareValues(%v, %q, %v) = %v, want error", tt.actual, tt.condition, tt.expected, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compareValues(%v, %q, %v) returned unexpected error: %v", tt.actual, tt.condition, tt.expected, err)
+			}
+			if got != tt.want {
+				t.Fatalf("compareValues(%v, %q, %v) = %v, want %v", tt.actual, tt.condition, tt.expected, got, tt.want)
+			}
+		})
+	}
+}